@@ -0,0 +1,108 @@
+// Package handler adapts httperror-returning handlers into http.Handler,
+// centralizing panic recovery and error rendering
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/acoshift/httperror"
+	"google.golang.org/grpc/status"
+)
+
+// HandlerFunc is an http handler that can return an error
+type HandlerFunc func(http.ResponseWriter, *http.Request) error
+
+// ErrorEncoder writes err, an *httperror.Error, as the response body
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, err error)
+
+// Logger receives the unwrapped cause of an error, so operators can log
+// internal details while the client receives a sanitized response
+type Logger func(err error)
+
+// DefaultErrorEncoder renders errors using httperror.Write
+var DefaultErrorEncoder ErrorEncoder = httperror.Write
+
+// DefaultLogger is a no-op Logger
+var DefaultLogger Logger = func(error) {}
+
+// Option configures Wrap
+type Option func(*handler)
+
+// WithErrorEncoder overrides the ErrorEncoder used to render errors
+func WithErrorEncoder(enc ErrorEncoder) Option {
+	return func(h *handler) {
+		h.encode = enc
+	}
+}
+
+// WithLogger overrides the Logger used to log the unwrapped cause
+func WithLogger(log Logger) Option {
+	return func(h *handler) {
+		h.log = log
+	}
+}
+
+type handler struct {
+	h      HandlerFunc
+	encode ErrorEncoder
+	log    Logger
+}
+
+// Wrap adapts h into an http.Handler: panics are recovered into an
+// InternalServerError (with the panic value as its cause), and any error
+// returned by h is rendered through ErrorEncoder after being logged
+func Wrap(h HandlerFunc, opts ...Option) http.Handler {
+	s := &handler{h: h, encode: DefaultErrorEncoder, log: DefaultLogger}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			e := httperror.InternalServerErrorWith(panicError(rec)).(*httperror.Error)
+			s.render(w, r, e)
+		}
+	}()
+
+	if err := s.h(w, r); err != nil {
+		s.handleError(w, r, err)
+	}
+}
+
+// panicError always wraps rec as a plain error, even if rec is itself an
+// error (or an *httperror.Error), so a recovered panic can never be
+// mistaken for the error it happens to carry and skip the 500 path
+func panicError(rec interface{}) error {
+	return fmt.Errorf("panic: %v", rec)
+}
+
+func (s *handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *httperror.Error
+	if !errors.As(err, &e) {
+		if _, ok := status.FromError(err); ok {
+			e, ok = httperror.GRPC(err).(*httperror.Error)
+			if !ok {
+				e = httperror.InternalServerErrorWith(err).(*httperror.Error)
+			}
+		} else {
+			e = httperror.InternalServerErrorWith(err).(*httperror.Error)
+		}
+	}
+
+	s.render(w, r, e)
+}
+
+func (s *handler) render(w http.ResponseWriter, r *http.Request, e *httperror.Error) {
+	if cause := e.Unwrap(); cause != nil {
+		s.log(cause)
+	} else {
+		s.log(e)
+	}
+
+	s.encode(w, r, e)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/acoshift/httperror"
+)
+
+func TestWrapReturnsError(t *testing.T) {
+	var logged error
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		return httperror.NotFoundWith(errors.New("user 42"))
+	}, WithLogger(func(err error) { logged = err }))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d; got %d", http.StatusNotFound, w.Code)
+	}
+	if logged == nil || logged.Error() != "user 42" {
+		t.Errorf("expected logged cause %q; got %v", "user 42", logged)
+	}
+}
+
+func TestWrapRecoversPanic(t *testing.T) {
+	var logged error
+	var encoded error
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		panic("boom")
+	}, WithLogger(func(err error) { logged = err }), WithErrorEncoder(func(w http.ResponseWriter, r *http.Request, err error) {
+		encoded = err
+		httperror.Write(w, r, err)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d; got %d", http.StatusInternalServerError, w.Code)
+	}
+	if logged == nil || logged.Error() != "panic: boom" {
+		t.Errorf("expected logged cause %q; got %v", "panic: boom", logged)
+	}
+	e, ok := encoded.(*httperror.Error)
+	if !ok {
+		t.Fatalf("expected encoded error to be *httperror.Error; got %T", encoded)
+	}
+	if e.Code != "internal_server_error" {
+		t.Errorf("expected code %q for a recovered panic; got %q", "internal_server_error", e.Code)
+	}
+}
+
+func TestWrapRecoversPanicWithError(t *testing.T) {
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		panic(httperror.NotFound)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected a panic to always produce status %d regardless of what was panicked with; got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestWrapCustomEncoder(t *testing.T) {
+	var encoded error
+	h := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		return httperror.BadRequest
+	}, WithErrorEncoder(func(w http.ResponseWriter, r *http.Request, err error) {
+		encoded = err
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected custom encoder to run; got status %d", w.Code)
+	}
+	if encoded == nil {
+		t.Errorf("expected custom encoder to receive the error")
+	}
+}
@@ -2,19 +2,70 @@
 package httperror
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"runtime"
+	"strings"
+	"sync"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// CaptureStack enables capturing a stack trace whenever an Error is created
+// via New, NewError, NewWithStatus, NewWithCode, Wrap, or the <Status>With helpers
+var CaptureStack bool
+
+// DebugMode includes the captured stack trace, if any, in the JSON output's
+// debug field. Leave disabled in production so responses stay clean
+var DebugMode bool
+
+const maxStackDepth = 32
+
 // Error is the httperror's Error
 type Error struct {
-	Status  int    `json:"status"`  // http status code
-	Code    string `json:"code"`    // error code
-	Message string `json:"message"` // error message
+	Status   int               `json:"status"`             // http status code
+	Code     string            `json:"code"`               // error code
+	Message  string            `json:"message"`            // error message
+	Type     string            `json:"type,omitempty"`     // uri identifying the error type
+	Instance string            `json:"instance,omitempty"` // uri identifying this occurrence of the error
+	Details  []interface{}     `json:"details,omitempty"`  // arbitrary typed detail payloads
+	Fields   map[string]string `json:"fields,omitempty"`   // per-field validation messages
+
+	cause error     // underlying error, not exposed over the wire
+	stack []uintptr // captured call stack, only set when CaptureStack is true
+}
+
+// withStack captures the current call stack into err when CaptureStack is
+// enabled, and returns err so it can be chained from a constructor
+func (err *Error) withStack() *Error {
+	if CaptureStack {
+		pcs := make([]uintptr, maxStackDepth)
+		n := runtime.Callers(3, pcs)
+		err.stack = pcs[:n]
+	}
+	return err
+}
+
+// StackTrace returns the call stack captured when err was created, or nil
+// if CaptureStack was disabled at creation time
+func (err *Error) StackTrace() []runtime.Frame {
+	if len(err.stack) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(err.stack)
+	var out []runtime.Frame
+	for {
+		frame, more := frames.Next()
+		out = append(out, frame)
+		if !more {
+			break
+		}
+	}
+	return out
 }
 
 // Error implements error interface
@@ -22,14 +73,149 @@ func (err *Error) Error() string {
 	return fmt.Sprintf("%s: [%d] %s", err.Code, err.Status, err.Message)
 }
 
-// Clone error
+// Unwrap returns the cause wrapped by err, if any, for use with errors.Unwrap
+func (err *Error) Unwrap() error {
+	return err.cause
+}
+
+// Is reports whether target is an *Error with the same status and code,
+// so errors.Is(err, httperror.NotFound) matches regardless of message or cause
+func (err *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || t == nil {
+		return false
+	}
+	return err.Status == t.Status && err.Code == t.Code
+}
+
+// As sets target to err if target is a **Error, for use with errors.As
+func (err *Error) As(target interface{}) bool {
+	p, ok := target.(**Error)
+	if !ok {
+		return false
+	}
+	*p = err
+	return true
+}
+
+// WithCause returns a clone of err with cause attached, so handlers can log
+// the real cause while returning a sanitized Error to the client. err itself
+// is left untouched, so it's safe to call on a shared *Error such as one of
+// the package-level pre-defined errors (BadRequest, NotFound, ...)
+func (err *Error) WithCause(cause error) *Error {
+	clone := err.Clone()
+	clone.cause = cause
+	return clone
+}
+
+// WithDetail returns a clone of err with v appended to Details. err itself is
+// left untouched, so it's safe to call on a shared *Error such as one of the
+// package-level pre-defined errors (BadRequest, NotFound, ...)
+func (err *Error) WithDetail(v interface{}) *Error {
+	clone := err.Clone()
+	clone.Details = append(clone.Details, v)
+	return clone
+}
+
+// WithField returns a clone of err with a per-field validation message set.
+// err itself is left untouched, so it's safe to call on a shared *Error such
+// as one of the package-level pre-defined errors (BadRequest, NotFound, ...)
+func (err *Error) WithField(name, msg string) *Error {
+	clone := err.Clone()
+	if clone.Fields == nil {
+		clone.Fields = make(map[string]string)
+	}
+	clone.Fields[name] = msg
+	return clone
+}
+
+// Clone error, deep-copying Fields and Details so mutating the clone via
+// WithField/WithDetail never leaks back into the original
 func (err Error) Clone() *Error {
+	if err.Fields != nil {
+		fields := make(map[string]string, len(err.Fields))
+		for k, v := range err.Fields {
+			fields[k] = v
+		}
+		err.Fields = fields
+	}
+	if err.Details != nil {
+		err.Details = append([]interface{}(nil), err.Details...)
+	}
 	return &err
 }
 
+// errorJSON is the wire shape of Error, kept separate so MarshalJSON/
+// UnmarshalJSON don't recurse and so the unexported cause/stack stay off the wire
+type errorJSON struct {
+	Status   int               `json:"status"`
+	Code     string            `json:"code"`
+	Message  string            `json:"message"`
+	Type     string            `json:"type,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Details  []interface{}     `json:"details,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Debug    []string          `json:"debug,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (err *Error) MarshalJSON() ([]byte, error) {
+	j := errorJSON{
+		Status:   err.Status,
+		Code:     err.Code,
+		Message:  err.Message,
+		Type:     err.Type,
+		Instance: err.Instance,
+		Details:  err.Details,
+		Fields:   err.Fields,
+		Debug:    debugFrames(err),
+	}
+	return json.Marshal(j)
+}
+
+// debugFrames formats err's captured stack trace for inclusion in a JSON
+// response, one string per frame (function, then file:line on the next
+// line), or nil when DebugMode is off
+func debugFrames(err *Error) []string {
+	if !DebugMode {
+		return nil
+	}
+	var frames []string
+	for _, frame := range err.StackTrace() {
+		frames = append(frames, fmt.Sprintf("%s\n\t%s:%d", frame.Function, frame.File, frame.Line))
+	}
+	return frames
+}
+
+// UnmarshalJSON implements json.Unmarshaler, letting a client reconstruct
+// the full error, including details and fields, from a response body
+func (err *Error) UnmarshalJSON(data []byte) error {
+	var j errorJSON
+	if e := json.Unmarshal(data, &j); e != nil {
+		return e
+	}
+	err.Status = j.Status
+	err.Code = j.Code
+	err.Message = j.Message
+	err.Type = j.Type
+	err.Instance = j.Instance
+	err.Details = j.Details
+	err.Fields = j.Fields
+	return nil
+}
+
 // NewError creates new Error
 func NewError(status int, code string, message string) error {
-	return &Error{Status: status, Code: code, Message: message}
+	return (&Error{Status: status, Code: code, Message: message}).withStack()
+}
+
+// Wrap creates a new Error from status and code, keeping err as its cause
+// so the original error survives in the chain for errors.Unwrap/Is/As
+func Wrap(err error, status int, code string) error {
+	if err == nil {
+		return nil
+	}
+	return (&Error{Status: status, Code: code, Message: err.Error()}).WithCause(err).withStack()
 }
 
 // Func is the error creator function
@@ -38,7 +224,7 @@ type Func func(error) error
 // New is the helper function for create Func
 func New(status int, code string) Func {
 	return func(err error) error {
-		return &Error{status, code, err.Error()}
+		return (&Error{Status: status, Code: code, Message: err.Error()}).withStack()
 	}
 }
 
@@ -48,7 +234,7 @@ type StatusFunc func(string, error) error
 // NewWithStatus is the helper function for create StatusFunc
 func NewWithStatus(status int) StatusFunc {
 	return func(code string, err error) error {
-		return &Error{status, code, err.Error()}
+		return (&Error{Status: status, Code: code, Message: err.Error()}).withStack()
 	}
 }
 
@@ -58,60 +244,114 @@ type CodeFunc func(int, error) error
 // NewWithCode is the helper function for create CodeFunc
 func NewWithCode(code string) CodeFunc {
 	return func(status int, err error) error {
-		return &Error{status, code, err.Error()}
+		return (&Error{Status: status, Code: code, Message: err.Error()}).withStack()
 	}
 }
 
 // NewHTTPError is the helper function for create http error
 func NewHTTPError(status int, code string) error {
-	return &Error{status, code, http.StatusText(status)}
+	return &Error{Status: status, Code: code, Message: http.StatusText(status)}
 }
 
+var statusCodeMu sync.RWMutex
+
 var mapHTTPStatusCode = map[int]string{
-	http.StatusBadRequest:          "bad_request",
-	http.StatusUnauthorized:        "unauthorized",
-	http.StatusForbidden:           "forbidden",
-	http.StatusNotFound:            "not_found",
-	http.StatusMethodNotAllowed:    "method_not_allowed",
-	http.StatusRequestTimeout:      "request_timeout",
-	http.StatusConflict:            "conflict",
-	http.StatusGone:                "gone",
-	http.StatusInternalServerError: "internal_server_error",
-	http.StatusNotImplemented:      "not_implemented",
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusPaymentRequired:       "payment_required",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusNotAcceptable:         "not_acceptable",
+	http.StatusRequestTimeout:        "request_timeout",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_server_error",
+	http.StatusNotImplemented:        "not_implemented",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "service_unavailable",
+	http.StatusGatewayTimeout:        "gateway_timeout",
+}
+
+// Register sets the error code returned by Registered for status, so
+// applications can add domain-specific statuses (e.g. 418) without forking
+// the package. Write's fallback for errors that aren't an *Error uses the code
+// registered for 500. NewHTTPError takes its code as an argument and does not
+// read the registry. Note that the package-level pre-defined errors
+// (BadRequest, NotFound, ...) and the <Status>With helpers built on them are
+// resolved once at package init, before any call to Register can run, so
+// registering a status after init does not change what they return; it only
+// affects later Registered lookups and Write's fallback path
+func Register(status int, code string) {
+	statusCodeMu.Lock()
+	defer statusCodeMu.Unlock()
+	mapHTTPStatusCode[status] = code
+}
+
+// Registered returns the code registered for status and whether one exists
+func Registered(status int) (string, bool) {
+	statusCodeMu.RLock()
+	defer statusCodeMu.RUnlock()
+	code, ok := mapHTTPStatusCode[status]
+	return code, ok
 }
 
 func newPreDefinedHTTPError(status int) error {
-	return NewHTTPError(status, mapHTTPStatusCode[status])
+	code, _ := Registered(status)
+	return NewHTTPError(status, code)
 }
 
 func newPreDefinedEmptyHTTPError(status int) error {
-	return NewError(status, mapHTTPStatusCode[status], "")
+	code, _ := Registered(status)
+	return NewError(status, code, "")
 }
 
 // Pre-defined errors
 var (
-	BadRequest          = newPreDefinedHTTPError(http.StatusBadRequest)
-	Unauthorized        = newPreDefinedHTTPError(http.StatusUnauthorized)
-	Forbidden           = newPreDefinedHTTPError(http.StatusForbidden)
-	NotFound            = newPreDefinedHTTPError(http.StatusNotFound)
-	MethodNotAllowed    = newPreDefinedHTTPError(http.StatusMethodNotAllowed)
-	RequestTimeout      = newPreDefinedHTTPError(http.StatusRequestTimeout)
-	Conflict            = newPreDefinedHTTPError(http.StatusConflict)
-	Gone                = newPreDefinedHTTPError(http.StatusGone)
-	InternalServerError = newPreDefinedHTTPError(http.StatusInternalServerError)
-	NotImplemented      = newPreDefinedHTTPError(http.StatusNotImplemented)
+	BadRequest           = newPreDefinedHTTPError(http.StatusBadRequest)
+	Unauthorized         = newPreDefinedHTTPError(http.StatusUnauthorized)
+	PaymentRequired      = newPreDefinedHTTPError(http.StatusPaymentRequired)
+	Forbidden            = newPreDefinedHTTPError(http.StatusForbidden)
+	NotFound             = newPreDefinedHTTPError(http.StatusNotFound)
+	MethodNotAllowed     = newPreDefinedHTTPError(http.StatusMethodNotAllowed)
+	NotAcceptable        = newPreDefinedHTTPError(http.StatusNotAcceptable)
+	RequestTimeout       = newPreDefinedHTTPError(http.StatusRequestTimeout)
+	Conflict             = newPreDefinedHTTPError(http.StatusConflict)
+	Gone                 = newPreDefinedHTTPError(http.StatusGone)
+	PayloadTooLarge      = newPreDefinedHTTPError(http.StatusRequestEntityTooLarge)
+	UnsupportedMediaType = newPreDefinedHTTPError(http.StatusUnsupportedMediaType)
+	UnprocessableEntity  = newPreDefinedHTTPError(http.StatusUnprocessableEntity)
+	TooManyRequests      = newPreDefinedHTTPError(http.StatusTooManyRequests)
+	InternalServerError  = newPreDefinedHTTPError(http.StatusInternalServerError)
+	NotImplemented       = newPreDefinedHTTPError(http.StatusNotImplemented)
+	BadGateway           = newPreDefinedHTTPError(http.StatusBadGateway)
+	ServiceUnavailable   = newPreDefinedHTTPError(http.StatusServiceUnavailable)
+	GatewayTimeout       = newPreDefinedHTTPError(http.StatusGatewayTimeout)
 
 	// Empty message errors
-	emptyBadRequest          = newPreDefinedEmptyHTTPError(http.StatusBadRequest)
-	emptyUnauthorized        = newPreDefinedEmptyHTTPError(http.StatusUnauthorized)
-	emptyForbidden           = newPreDefinedEmptyHTTPError(http.StatusForbidden)
-	emptyNotFound            = newPreDefinedEmptyHTTPError(http.StatusNotFound)
-	emptyMethodNotAllowed    = newPreDefinedEmptyHTTPError(http.StatusMethodNotAllowed)
-	emptyRequestTimeout      = newPreDefinedEmptyHTTPError(http.StatusRequestTimeout)
-	emptyConflict            = newPreDefinedEmptyHTTPError(http.StatusConflict)
-	emptyGone                = newPreDefinedEmptyHTTPError(http.StatusGone)
-	emptyInternalServerError = newPreDefinedEmptyHTTPError(http.StatusInternalServerError)
-	emptyNotImplemented      = newPreDefinedEmptyHTTPError(http.StatusNotImplemented)
+	emptyBadRequest           = newPreDefinedEmptyHTTPError(http.StatusBadRequest)
+	emptyUnauthorized         = newPreDefinedEmptyHTTPError(http.StatusUnauthorized)
+	emptyPaymentRequired      = newPreDefinedEmptyHTTPError(http.StatusPaymentRequired)
+	emptyForbidden            = newPreDefinedEmptyHTTPError(http.StatusForbidden)
+	emptyNotFound             = newPreDefinedEmptyHTTPError(http.StatusNotFound)
+	emptyMethodNotAllowed     = newPreDefinedEmptyHTTPError(http.StatusMethodNotAllowed)
+	emptyNotAcceptable        = newPreDefinedEmptyHTTPError(http.StatusNotAcceptable)
+	emptyRequestTimeout       = newPreDefinedEmptyHTTPError(http.StatusRequestTimeout)
+	emptyConflict             = newPreDefinedEmptyHTTPError(http.StatusConflict)
+	emptyGone                 = newPreDefinedEmptyHTTPError(http.StatusGone)
+	emptyPayloadTooLarge      = newPreDefinedEmptyHTTPError(http.StatusRequestEntityTooLarge)
+	emptyUnsupportedMediaType = newPreDefinedEmptyHTTPError(http.StatusUnsupportedMediaType)
+	emptyUnprocessableEntity  = newPreDefinedEmptyHTTPError(http.StatusUnprocessableEntity)
+	emptyTooManyRequests      = newPreDefinedEmptyHTTPError(http.StatusTooManyRequests)
+	emptyInternalServerError  = newPreDefinedEmptyHTTPError(http.StatusInternalServerError)
+	emptyNotImplemented       = newPreDefinedEmptyHTTPError(http.StatusNotImplemented)
+	emptyBadGateway           = newPreDefinedEmptyHTTPError(http.StatusBadGateway)
+	emptyServiceUnavailable   = newPreDefinedEmptyHTTPError(http.StatusServiceUnavailable)
+	emptyGatewayTimeout       = newPreDefinedEmptyHTTPError(http.StatusGatewayTimeout)
 )
 
 // Merge an error with other error
@@ -130,6 +370,10 @@ func Merge(err, other error) error {
 			r.Message += "; "
 		}
 		r.Message += other.Error()
+		if r.cause == nil {
+			r.cause = other
+		}
+		r.withStack()
 		return r
 	}
 	if e, ok := other.(*Error); ok {
@@ -138,6 +382,10 @@ func Merge(err, other error) error {
 			r.Message += "; "
 		}
 		r.Message += err.Error()
+		if r.cause == nil {
+			r.cause = err
+		}
+		r.withStack()
 		return r
 	}
 	return errors.New(err.Error() + "; " + other.Error())
@@ -153,6 +401,11 @@ func UnauthorizedWith(err error) error {
 	return Merge(emptyUnauthorized, err)
 }
 
+// PaymentRequiredWith merges error with payment required
+func PaymentRequiredWith(err error) error {
+	return Merge(emptyPaymentRequired, err)
+}
+
 // ForbiddenWith merges error with forbidden
 func ForbiddenWith(err error) error {
 	return Merge(emptyForbidden, err)
@@ -168,6 +421,11 @@ func MethodNotAllowedWith(err error) error {
 	return Merge(emptyMethodNotAllowed, err)
 }
 
+// NotAcceptableWith merges error with not acceptable
+func NotAcceptableWith(err error) error {
+	return Merge(emptyNotAcceptable, err)
+}
+
 // RequestTimeoutWith merges error with request timeout
 func RequestTimeoutWith(err error) error {
 	return Merge(emptyRequestTimeout, err)
@@ -183,11 +441,52 @@ func GoneWith(err error) error {
 	return Merge(emptyGone, err)
 }
 
+// PayloadTooLargeWith merges error with payload too large
+func PayloadTooLargeWith(err error) error {
+	return Merge(emptyPayloadTooLarge, err)
+}
+
+// UnsupportedMediaTypeWith merges error with unsupported media type
+func UnsupportedMediaTypeWith(err error) error {
+	return Merge(emptyUnsupportedMediaType, err)
+}
+
+// UnprocessableEntityWith merges error with unprocessable entity
+func UnprocessableEntityWith(err error) error {
+	return Merge(emptyUnprocessableEntity, err)
+}
+
+// TooManyRequestsWith merges error with too many requests
+func TooManyRequestsWith(err error) error {
+	return Merge(emptyTooManyRequests, err)
+}
+
 // InternalServerErrorWith merges error with internal server error
 func InternalServerErrorWith(err error) error {
 	return Merge(emptyInternalServerError, err)
 }
 
+// BadGatewayWith merges error with bad gateway
+func BadGatewayWith(err error) error {
+	return Merge(emptyBadGateway, err)
+}
+
+// ServiceUnavailableWith merges error with service unavailable
+func ServiceUnavailableWith(err error) error {
+	return Merge(emptyServiceUnavailable, err)
+}
+
+// GatewayTimeoutWith merges error with gateway timeout
+func GatewayTimeoutWith(err error) error {
+	return Merge(emptyGatewayTimeout, err)
+}
+
+// wrapGRPC creates an Error from status and code, keeping the original
+// grpc error as its cause so it survives the http/grpc conversion
+func wrapGRPC(cause error, status int, code, message string) error {
+	return (&Error{Status: status, Code: code, Message: message}).WithCause(cause)
+}
+
 // GRPC maps grpc error to http error
 func GRPC(err error) error {
 	if err == nil {
@@ -199,38 +498,174 @@ func GRPC(err error) error {
 	case codes.OK:
 		return nil
 	case codes.Canceled:
-		return NewError(http.StatusRequestTimeout, "canceled", desc)
+		return wrapGRPC(err, http.StatusRequestTimeout, "canceled", desc)
 	case codes.Unknown:
-		return NewError(http.StatusInternalServerError, "unknown", desc)
+		return wrapGRPC(err, http.StatusInternalServerError, "unknown", desc)
 	case codes.InvalidArgument:
-		return NewError(http.StatusBadRequest, "invalid_argument", desc)
+		return wrapGRPC(err, http.StatusBadRequest, "invalid_argument", desc)
 	case codes.DeadlineExceeded:
-		return NewError(http.StatusRequestTimeout, "deadline_exceeded", desc)
+		return wrapGRPC(err, http.StatusRequestTimeout, "deadline_exceeded", desc)
 	case codes.NotFound:
-		return NewError(http.StatusNotFound, "not_found", desc)
+		return wrapGRPC(err, http.StatusNotFound, "not_found", desc)
 	case codes.AlreadyExists:
-		return NewError(http.StatusConflict, "already_exists", desc)
+		return wrapGRPC(err, http.StatusConflict, "already_exists", desc)
 	case codes.PermissionDenied:
-		return NewError(http.StatusForbidden, "permission_denied", desc)
+		return wrapGRPC(err, http.StatusForbidden, "permission_denied", desc)
 	case codes.Unauthenticated:
-		return NewError(http.StatusUnauthorized, "unauthenticated", desc)
+		return wrapGRPC(err, http.StatusUnauthorized, "unauthenticated", desc)
 	case codes.ResourceExhausted:
-		return NewError(http.StatusForbidden, "resource_exhausted", desc)
+		return wrapGRPC(err, http.StatusForbidden, "resource_exhausted", desc)
 	case codes.FailedPrecondition:
-		return NewError(http.StatusPreconditionFailed, "failed_precondition", desc)
+		return wrapGRPC(err, http.StatusPreconditionFailed, "failed_precondition", desc)
 	case codes.Aborted:
-		return NewError(http.StatusConflict, "aborted", desc)
+		return wrapGRPC(err, http.StatusConflict, "aborted", desc)
 	case codes.OutOfRange:
-		return NewError(http.StatusBadRequest, "out_of_range", desc)
+		return wrapGRPC(err, http.StatusBadRequest, "out_of_range", desc)
 	case codes.Unimplemented:
-		return NewError(http.StatusNotImplemented, "unimplemented", desc)
+		return wrapGRPC(err, http.StatusNotImplemented, "unimplemented", desc)
 	case codes.Internal:
-		return NewError(http.StatusInternalServerError, "internal", desc)
+		return wrapGRPC(err, http.StatusInternalServerError, "internal", desc)
 	case codes.Unavailable:
-		return NewError(http.StatusServiceUnavailable, "service_unavailable", desc)
+		return wrapGRPC(err, http.StatusServiceUnavailable, "service_unavailable", desc)
 	case codes.DataLoss:
-		return NewError(http.StatusInternalServerError, "data_loss", desc)
+		return wrapGRPC(err, http.StatusInternalServerError, "data_loss", desc)
 	default:
 		return err
 	}
 }
+
+// mapCodeToGRPCCode reverses the code strings produced by GRPC back to
+// their originating codes.Code, so ToGRPC(GRPC(err)) round-trips
+var mapCodeToGRPCCode = map[string]codes.Code{
+	"canceled":            codes.Canceled,
+	"unknown":             codes.Unknown,
+	"invalid_argument":    codes.InvalidArgument,
+	"deadline_exceeded":   codes.DeadlineExceeded,
+	"not_found":           codes.NotFound,
+	"already_exists":      codes.AlreadyExists,
+	"permission_denied":   codes.PermissionDenied,
+	"unauthenticated":     codes.Unauthenticated,
+	"resource_exhausted":  codes.ResourceExhausted,
+	"failed_precondition": codes.FailedPrecondition,
+	"aborted":             codes.Aborted,
+	"out_of_range":        codes.OutOfRange,
+	"unimplemented":       codes.Unimplemented,
+	"internal":            codes.Internal,
+	"service_unavailable": codes.Unavailable,
+	"data_loss":           codes.DataLoss,
+}
+
+// mapHTTPStatusToGRPCCode is the fallback used when Code has no entry in
+// mapCodeToGRPCCode, e.g. the pre-defined errors and application-registered
+// codes. It covers every status in mapHTTPStatusCode as of this writing; a
+// Register call for a status not listed here falls through to the
+// status-range guess in grpcCodeFor
+var mapHTTPStatusToGRPCCode = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusPaymentRequired:       codes.FailedPrecondition,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusMethodNotAllowed:      codes.Unimplemented,
+	http.StatusNotAcceptable:         codes.InvalidArgument,
+	http.StatusRequestTimeout:        codes.DeadlineExceeded,
+	http.StatusConflict:              codes.Aborted,
+	http.StatusGone:                  codes.NotFound,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnsupportedMediaType:  codes.InvalidArgument,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusInternalServerError:   codes.Internal,
+	http.StatusNotImplemented:        codes.Unimplemented,
+	http.StatusBadGateway:            codes.Unavailable,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+// grpcCodeFor derives the codes.Code for an Error, preferring its Code
+// string, then a mapping from Status, then a coarse guess from the status
+// range for statuses Register-ed at runtime that have no explicit mapping
+func grpcCodeFor(err *Error) codes.Code {
+	if c, ok := mapCodeToGRPCCode[err.Code]; ok {
+		return c
+	}
+	if c, ok := mapHTTPStatusToGRPCCode[err.Status]; ok {
+		return c
+	}
+	switch {
+	case err.Status >= 500:
+		return codes.Internal
+	case err.Status >= 400:
+		return codes.InvalidArgument
+	default:
+		return codes.Unknown
+	}
+}
+
+// ToGRPC maps an Error back to a grpc error, the inverse of GRPC. The
+// codes.Code is derived from Code, falling back to Status, and Message
+// becomes the grpc status description.
+//
+// GRPC(ToGRPC(e)) only round-trips e exactly when its Status and Code are a
+// pair GRPC itself produces (e.g. 404 "not_found", 409 "aborted") since grpc
+// has far fewer codes than this package has statuses/registered codes; for
+// every other error ToGRPC still chooses a reasonable codes.Code, but
+// converting that back with GRPC will land on whatever status and code GRPC
+// associates with that codes.Code (e.g. InternalServerError comes back with
+// code "internal" rather than "internal_server_error")
+func ToGRPC(err error) error {
+	if err == nil {
+		return nil
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		return err
+	}
+	return status.New(grpcCodeFor(e), e.Message).Err()
+}
+
+// problemJSON is the RFC 7807 application/problem+json representation
+type problemJSON struct {
+	Type     string            `json:"type,omitempty"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Details  []interface{}     `json:"details,omitempty"`
+	Debug    []string          `json:"debug,omitempty"`
+}
+
+// Write renders err as a JSON response, negotiating between
+// application/problem+json (RFC 7807) and this package's flat JSON shape
+// based on the request's Accept header
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		code, _ := Registered(http.StatusInternalServerError)
+		e = NewError(http.StatusInternalServerError, code, err.Error()).(*Error)
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/problem+json") {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(problemJSON{
+			Type:     e.Type,
+			Title:    e.Code,
+			Status:   e.Status,
+			Detail:   e.Message,
+			Instance: e.Instance,
+			Fields:   e.Fields,
+			Details:  e.Details,
+			Debug:    debugFrames(e),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
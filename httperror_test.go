@@ -1,8 +1,15 @@
 package httperror
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMerge(t *testing.T) {
@@ -40,3 +47,306 @@ func TestMerge(t *testing.T) {
 		}
 	}
 }
+
+func TestWrapAndIs(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Wrap(cause, http.StatusNotFound, "not_found")
+
+	if !errors.Is(err, NotFound) {
+		t.Errorf("expected errors.Is(err, NotFound) to be true")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected errors.Is(err, cause) to be true")
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Errorf("expected errors.As(err, &e) to be true")
+	}
+	if e.Message != cause.Error() {
+		t.Errorf("expected message %q; got %q", cause.Error(), e.Message)
+	}
+
+	if errors.Unwrap(err) != cause {
+		t.Errorf("expected errors.Unwrap(err) to return cause")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const status = 418
+
+	if _, ok := Registered(status); ok {
+		t.Fatalf("expected status %d to not be registered", status)
+	}
+
+	Register(status, "teapot")
+
+	code, ok := Registered(status)
+	if !ok {
+		t.Fatalf("expected status %d to be registered", status)
+	}
+	if code != "teapot" {
+		t.Errorf("expected code %q; got %q", "teapot", code)
+	}
+
+	err := NewHTTPError(status, code).(*Error)
+	if err.Code != "teapot" {
+		t.Errorf("expected NewHTTPError to use registered code; got %q", err.Code)
+	}
+}
+
+func TestCloneDoesNotShareFieldsOrDetails(t *testing.T) {
+	e1 := NewError(http.StatusBadRequest, "invalid_argument", "invalid payload").(*Error)
+	e1 = e1.WithField("email", "required")
+	e1 = e1.WithDetail("detail1")
+
+	e2 := e1.Clone()
+	e2 = e2.WithField("name", "required")
+	e2 = e2.WithDetail("detail2")
+
+	if _, ok := e1.Fields["name"]; ok {
+		t.Errorf("expected clone's WithField to not leak into original; got %+v", e1.Fields)
+	}
+	if len(e1.Details) != 1 {
+		t.Errorf("expected clone's WithDetail to not leak into original; got %+v", e1.Details)
+	}
+}
+
+func TestWithFieldAndWithDetailDoNotMutateReceiver(t *testing.T) {
+	e := NewError(http.StatusBadRequest, "invalid_argument", "invalid payload").(*Error)
+
+	withField := e.WithField("email", "required")
+	withDetail := e.WithDetail("detail1")
+
+	if e.Fields != nil {
+		t.Errorf("expected WithField to leave the receiver untouched; got %+v", e.Fields)
+	}
+	if e.Details != nil {
+		t.Errorf("expected WithDetail to leave the receiver untouched; got %+v", e.Details)
+	}
+	if withField.Fields["email"] != "required" {
+		t.Errorf("expected returned clone to carry the field; got %+v", withField.Fields)
+	}
+	if len(withDetail.Details) != 1 {
+		t.Errorf("expected returned clone to carry the detail; got %+v", withDetail.Details)
+	}
+
+	// calling BadRequest.WithField/WithDetail must leave the shared singleton
+	// untouched, so concurrent callers never race on it
+	BadRequest.(*Error).WithField("email", "required")
+	BadRequest.(*Error).WithDetail("detail1")
+	if BadRequest.(*Error).Details != nil {
+		t.Errorf("expected package-level BadRequest to stay untouched; got %+v", BadRequest.(*Error).Details)
+	}
+	if BadRequest.(*Error).Fields != nil {
+		t.Errorf("expected package-level BadRequest to stay untouched; got %+v", BadRequest.(*Error).Fields)
+	}
+}
+
+func TestWithCauseDoesNotMutateReceiver(t *testing.T) {
+	e := NewError(http.StatusNotFound, "not_found", "not found").(*Error)
+	cause := errors.New("row 42 missing")
+
+	withCause := e.WithCause(cause)
+
+	if e.Unwrap() != nil {
+		t.Errorf("expected WithCause to leave the receiver untouched; got cause %v", e.Unwrap())
+	}
+	if withCause.Unwrap() != cause {
+		t.Errorf("expected returned clone to carry the cause; got %v", withCause.Unwrap())
+	}
+
+	// calling NotFound.WithCause concurrently must never race on or
+	// permanently corrupt the shared singleton
+	if NotFound.(*Error).WithCause(cause); NotFound.(*Error).Unwrap() != nil {
+		t.Errorf("expected package-level NotFound to stay untouched; got cause %v", NotFound.(*Error).Unwrap())
+	}
+}
+
+func TestMarshalUnmarshalJSON(t *testing.T) {
+	e := NewError(http.StatusBadRequest, "invalid_argument", "invalid payload").(*Error)
+	e = e.WithField("email", "must be a valid email")
+	e = e.WithDetail(map[string]string{"hint": "check the format"})
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+
+	var got Error
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+
+	if got.Status != e.Status || got.Code != e.Code || got.Message != e.Message {
+		t.Errorf("round-trip mismatch: got %+v; want %+v", got, e)
+	}
+	if got.Fields["email"] != "must be a valid email" {
+		t.Errorf("expected fields to round-trip; got %+v", got.Fields)
+	}
+	if len(got.Details) != 1 {
+		t.Errorf("expected 1 detail to round-trip; got %d", len(got.Details))
+	}
+}
+
+func TestWrite(t *testing.T) {
+	e := NotFoundWith(errors.New("user 42"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	Write(w, r, e)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d; got %d", http.StatusNotFound, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("expected content type application/problem+json; got %q", ct)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	Write(w, r, e)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected content type application/json; got %q", ct)
+	}
+}
+
+func TestWritePlainErrorUsesRegisteredCode(t *testing.T) {
+	prev, _ := Registered(http.StatusInternalServerError)
+	Register(http.StatusInternalServerError, "custom_internal_error")
+	defer Register(http.StatusInternalServerError, prev)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	Write(w, r, errors.New("boom"))
+
+	var got Error
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if got.Code != "custom_internal_error" {
+		t.Errorf("expected registered code %q; got %q", "custom_internal_error", got.Code)
+	}
+}
+
+func TestIsTypedNilTarget(t *testing.T) {
+	var nilErr *Error
+	if errors.Is(NotFound, nilErr) {
+		t.Errorf("expected errors.Is(NotFound, nilErr) to be false")
+	}
+}
+
+func TestCaptureStack(t *testing.T) {
+	CaptureStack = true
+	defer func() { CaptureStack = false }()
+
+	e := NewError(http.StatusInternalServerError, "internal_server_error", "boom").(*Error)
+	if len(e.StackTrace()) == 0 {
+		t.Errorf("expected a non-empty stack trace when CaptureStack is enabled")
+	}
+
+	CaptureStack = false
+	e2 := NewError(http.StatusInternalServerError, "internal_server_error", "boom").(*Error)
+	if e2.StackTrace() != nil {
+		t.Errorf("expected no stack trace when CaptureStack is disabled")
+	}
+}
+
+func TestCaptureStackNewWithStatusAndCode(t *testing.T) {
+	CaptureStack = true
+	defer func() { CaptureStack = false }()
+
+	e1 := NewWithStatus(http.StatusBadRequest)("invalid_argument", errors.New("boom")).(*Error)
+	if len(e1.StackTrace()) == 0 {
+		t.Errorf("expected NewWithStatus to capture a stack trace when CaptureStack is enabled")
+	}
+
+	e2 := NewWithCode("invalid_argument")(http.StatusBadRequest, errors.New("boom")).(*Error)
+	if len(e2.StackTrace()) == 0 {
+		t.Errorf("expected NewWithCode to capture a stack trace when CaptureStack is enabled")
+	}
+}
+
+func TestDebugModeInJSON(t *testing.T) {
+	CaptureStack = true
+	DebugMode = true
+	defer func() { CaptureStack = false; DebugMode = false }()
+
+	e := NewError(http.StatusInternalServerError, "internal_server_error", "boom").(*Error)
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+	if !strings.Contains(string(b), `"debug"`) {
+		t.Errorf("expected debug field in JSON output; got %s", b)
+	}
+}
+
+func TestDebugModeInProblemJSON(t *testing.T) {
+	CaptureStack = true
+	DebugMode = true
+	defer func() { CaptureStack = false; DebugMode = false }()
+
+	e := NewError(http.StatusInternalServerError, "internal_server_error", "boom").(*Error)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	Write(w, r, e)
+
+	if !strings.Contains(w.Body.String(), `"debug"`) {
+		t.Errorf("expected debug field in problem+json output; got %s", w.Body.String())
+	}
+}
+
+func TestToGRPCRoundTrip(t *testing.T) {
+	cases := []error{
+		NewError(http.StatusNotFound, "not_found", "user not found"),
+		NewError(http.StatusBadRequest, "invalid_argument", "invalid payload"),
+		NewError(http.StatusConflict, "aborted", "transaction aborted"),
+	}
+
+	for _, c := range cases {
+		e := c.(*Error)
+		r := GRPC(ToGRPC(e)).(*Error)
+		if r.Status != e.Status || r.Code != e.Code || r.Message != e.Message {
+			t.Errorf("round-trip mismatch: got %+v; want %+v", r, e)
+		}
+	}
+}
+
+// TestToGRPCDoesNotCollapseToUnknown guards against ToGRPC silently
+// discarding status/code for statuses GRPC itself can't roundtrip exactly
+// (it only has as many grpc codes as GRPC's switch handles). It's not a
+// round-trip assertion like TestToGRPCRoundTrip, just coverage that newer
+// pre-defined and Register-ed statuses still get a specific, non-Unknown code.
+func TestToGRPCDoesNotCollapseToUnknown(t *testing.T) {
+	Register(599, "app_specific")
+
+	cases := []error{
+		PaymentRequired,
+		NotAcceptable,
+		PayloadTooLarge,
+		UnsupportedMediaType,
+		UnprocessableEntity,
+		TooManyRequests,
+		BadGateway,
+		ServiceUnavailable,
+		GatewayTimeout,
+		NewError(599, "app_specific", "custom"),
+	}
+
+	for _, c := range cases {
+		e := c.(*Error)
+		g := ToGRPC(e)
+		s, ok := status.FromError(g)
+		if !ok {
+			t.Fatalf("expected ToGRPC to return a grpc status error for %+v", e)
+		}
+		if s.Code() == codes.Unknown {
+			t.Errorf("expected a specific grpc code for status %d code %q; got Unknown", e.Status, e.Code)
+		}
+	}
+}